@@ -3,31 +3,132 @@ package clarifai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"mime/multipart"
-	"os"
-	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Configurations
 const (
 	version = "v1"
 	rootURL = "https://api.clarifai.com"
+
+	// defaultUploadConcurrency is the number of upload worker goroutines
+	// within a single TagRequest/TagReaders call when Client.UploadConcurrency
+	// is left unset.
+	defaultUploadConcurrency = 4
+
+	// defaultMaxFileSize and defaultMaxRequestSize bound the size of a
+	// streamed multipart upload so a runaway batch is rejected instead of
+	// exhausting memory or bandwidth.
+	defaultMaxFileSize    = 10 << 20  // 10MB
+	defaultMaxRequestSize = 100 << 20 // 100MB
+
+	// defaultMaxRetries, defaultBaseBackoff and defaultMaxBackoff configure
+	// the full-jitter exponential backoff used to retry throttled (429) and
+	// transient (5xx) responses when Client.MaxRetries/BaseBackoff/MaxBackoff
+	// are left unset.
+	defaultMaxRetries  = 3
+	defaultBaseBackoff = 500 * time.Millisecond
+	defaultMaxBackoff  = 30 * time.Second
+
+	// defaultThrottleCooldown is used when a 429 response doesn't carry a
+	// Retry-After header.
+	defaultThrottleCooldown = 30 * time.Second
+
+	// defaultRefreshWindow is how long before a token's reported expiry
+	// requestAccessToken proactively refreshes it, when Client.RefreshWindow
+	// is left unset.
+	defaultRefreshWindow = 60 * time.Second
 )
 
-// Client contains scoped variables forindividual clients
+// Client contains scoped variables for individual clients
 type Client struct {
 	ClientID     string
 	ClientSecret string
 	AccessToken  string
 	APIRoot      string
-	Throttled    bool
+
+	// HTTPClient is used to perform every request made by this Client. It
+	// defaults to a plain &http.Client{} in NewClient, but callers may
+	// supply their own to control connection reuse, timeouts, proxies, or
+	// tracing.
+	HTTPClient *http.Client
+
+	// ReAuth, when set, is called instead of the default requestAccessToken
+	// before the first request and whenever the API reports a 401. It is
+	// expected to install the new token by setting AccessToken. This lets
+	// callers load a cached token
+	// from disk, coordinate a refresh across processes, or plug in an
+	// entirely different OAuth flow.
+	ReAuth func(ctx context.Context) error
+
+	// TokenStore, when set, is consulted before requesting a new access
+	// token and written to after one is obtained, so a short-lived CLI
+	// doesn't request a new token on every invocation and a long-running
+	// service can share a cached token across restarts.
+	TokenStore TokenStore
+
+	// RefreshWindow is how long before a token's reported expiry
+	// requestAccessToken proactively refreshes it. Defaults to
+	// defaultRefreshWindow when left at zero.
+	RefreshWindow time.Duration
+
+	// ResponseInterceptor, when set, is called with every API response this
+	// Client receives before its status code is interpreted (responses from
+	// the token endpoint in requestAccessToken are not passed to it), letting
+	// callers observe headers like X-Throttle-* or capture raw bodies for
+	// logging. Returning an error aborts the request with that error.
+	ResponseInterceptor func(*http.Response) error
+
+	// UploadConcurrency is the number of worker goroutines used when a
+	// TagRequest or TagReaders call carries more than one file. Each worker
+	// writes its whole file into the request body under a shared lock, so
+	// the files themselves are streamed one at a time. Defaults to
+	// defaultUploadConcurrency when left at zero.
+	UploadConcurrency int
+
+	// MaxFileSize and MaxRequestSize bound a streamed multipart upload,
+	// rejecting it as soon as a file or the batch as a whole exceeds the
+	// limit instead of buffering it all into memory first. A zero value
+	// falls back to the default limit; a negative value disables it.
+	MaxFileSize    int64
+	MaxRequestSize int64
+
+	// MaxRetries, BaseBackoff and MaxBackoff configure retries of throttled
+	// (429) and transient (5xx) responses, using full-jitter exponential
+	// backoff. Defaults apply when left at zero; a negative MaxRetries
+	// disables retrying.
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	tokenMu        sync.Mutex
+	inflight       *tokenCall
+	tokenObtained  bool
+	tokenExpiresAt time.Time
+
+	// throttledUntilNano is the UnixNano timestamp at which throttling
+	// lifts, updated atomically so concurrent callers can check IsThrottled
+	// without taking a lock.
+	throttledUntilNano int64
+}
+
+// tokenCall represents an access token refresh in flight, so concurrent
+// requests that all hit a 401 at once collapse into a single refresh.
+type tokenCall struct {
+	done chan struct{}
+	err  error
 }
 
 // TokenResp is the expected response from /token/
@@ -36,32 +137,223 @@ type TokenResp struct {
 	ExpiresIn   int    `json:"expires_in"`
 	Scope       string `json:"scope"`
 	TokenType   string `json:"token_type"`
+
+	// ObtainedAt is when this token was issued, recorded locally since
+	// Clarifai's response only carries a relative ExpiresIn. A TokenStore
+	// implementation should persist it alongside the rest of the token.
+	ObtainedAt time.Time `json:"obtained_at"`
+}
+
+// expiresAt returns when token stops being valid, or the zero Time if
+// ExpiresIn wasn't set.
+func (t TokenResp) expiresAt() time.Time {
+	if t.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return t.ObtainedAt.Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+// validFor reports whether token is usable for at least window longer,
+// treating a token with no known expiry as valid as long as it's non-empty.
+func (t TokenResp) validFor(window time.Duration) bool {
+	if t.AccessToken == "" {
+		return false
+	}
+	exp := t.expiresAt()
+	if exp.IsZero() {
+		return true
+	}
+	return time.Now().Add(window).Before(exp)
+}
+
+// TokenStore persists access tokens across process restarts.
+type TokenStore interface {
+	Load(ctx context.Context) (TokenResp, error)
+	Save(ctx context.Context, token TokenResp) error
 }
 
 // NewClient initializes a new Clarifai client
 func NewClient(clientID, clientSecret string) *Client {
-	return &Client{clientID, clientSecret, "unasigned", rootURL, false}
+	return &Client{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AccessToken:  "unasigned",
+		APIRoot:      rootURL,
+		HTTPClient:   &http.Client{},
+
+		UploadConcurrency: defaultUploadConcurrency,
+		MaxFileSize:       defaultMaxFileSize,
+		MaxRequestSize:    defaultMaxRequestSize,
+
+		MaxRetries:  defaultMaxRetries,
+		BaseBackoff: defaultBaseBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+	}
+}
+
+// IsThrottled reports whether the client is still within a throttling
+// cool-down window reported by a previous 429 response.
+func (client *Client) IsThrottled() bool {
+	return time.Now().Before(client.throttledUntil())
+}
+
+func (client *Client) throttledUntil() time.Time {
+	ns := atomic.LoadInt64(&client.throttledUntilNano)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func (client *Client) setThrottledUntil(t time.Time) {
+	atomic.StoreInt64(&client.throttledUntilNano, t.UnixNano())
+}
+
+func (client *Client) maxRetries() int {
+	if client.MaxRetries < 0 {
+		return 0
+	}
+	if client.MaxRetries != 0 {
+		return client.MaxRetries
+	}
+	return defaultMaxRetries
+}
+
+func (client *Client) baseBackoff() time.Duration {
+	if client.BaseBackoff > 0 {
+		return client.BaseBackoff
+	}
+	return defaultBaseBackoff
+}
+
+func (client *Client) maxBackoff() time.Duration {
+	if client.MaxBackoff > 0 {
+		return client.MaxBackoff
+	}
+	return defaultMaxBackoff
 }
 
-func (client *Client) requestAccessToken() error {
+func (client *Client) refreshWindow() time.Duration {
+	if client.RefreshWindow > 0 {
+		return client.RefreshWindow
+	}
+	return defaultRefreshWindow
+}
+
+// ensureFreshToken proactively refreshes the access token when it's known
+// to expire within the refresh window, or hasn't been obtained at all yet,
+// instead of waiting to be told via a 401.
+func (client *Client) ensureFreshToken(ctx context.Context) error {
+	client.tokenMu.Lock()
+	obtained := client.tokenObtained
+	exp := client.tokenExpiresAt
+	client.tokenMu.Unlock()
+
+	// A freshly constructed Client hasn't obtained or loaded a token yet -
+	// refresh (which consults TokenStore first) rather than sending the
+	// placeholder AccessToken and waiting to be told via a 401.
+	if !obtained {
+		return client.refreshToken(ctx)
+	}
+
+	if exp.IsZero() || time.Now().Add(client.refreshWindow()).Before(exp) {
+		return nil
+	}
+	return client.refreshToken(ctx)
+}
+
+func (client *Client) uploadConcurrency() int {
+	if client.UploadConcurrency > 0 {
+		return client.UploadConcurrency
+	}
+	return defaultUploadConcurrency
+}
+
+func (client *Client) maxFileSize() int64 {
+	if client.MaxFileSize != 0 {
+		return client.MaxFileSize
+	}
+	return defaultMaxFileSize
+}
+
+func (client *Client) maxRequestSize() int64 {
+	if client.MaxRequestSize != 0 {
+		return client.MaxRequestSize
+	}
+	return defaultMaxRequestSize
+}
+
+// refreshToken acquires a new access token, using ReAuth if the caller
+// supplied one and falling back to requestAccessToken otherwise. Concurrent
+// callers share a single in-flight refresh instead of each hitting the
+// token endpoint.
+func (client *Client) refreshToken(ctx context.Context) error {
+	client.tokenMu.Lock()
+	if call := client.inflight; call != nil {
+		client.tokenMu.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	client.inflight = call
+	client.tokenMu.Unlock()
+
+	var err error
+	if client.ReAuth != nil {
+		err = client.ReAuth(ctx)
+	} else {
+		err = client.requestAccessToken(ctx)
+	}
+
+	client.tokenMu.Lock()
+	client.inflight = nil
+	if err == nil && client.ReAuth != nil {
+		// ReAuth installs its token itself, with no known expiry; record
+		// that one is in place so ensureFreshToken doesn't call it again
+		// before every request.
+		client.tokenObtained = true
+		client.tokenExpiresAt = time.Time{}
+	}
+	client.tokenMu.Unlock()
+
+	call.err = err
+	close(call.done)
+	return err
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient != nil {
+		return client.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (client *Client) requestAccessToken(ctx context.Context) error {
+	if client.TokenStore != nil {
+		if cached, err := client.TokenStore.Load(ctx); err == nil && cached.validFor(client.refreshWindow()) {
+			client.setToken(cached)
+			return nil
+		}
+	}
+
 	form := url.Values{}
 	form.Set("grant_type", "client_credentials")
 	form.Set("client_id", client.ClientID)
 	form.Set("client_secret", client.ClientSecret)
 	formData := strings.NewReader(form.Encode())
 
-	req, err := http.NewRequest("POST", client.buildURL("token"), formData)
+	req, err := http.NewRequestWithContext(ctx, "POST", client.buildURL("token"), formData)
 
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Authorization", "Bearer "+client.token())
 	req.Header.Set("Content-Length", strconv.Itoa(len(form.Encode())))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	httpClient := &http.Client{}
-	res, err := httpClient.Do(req)
+	res, err := client.httpClient().Do(req)
 
 	if err != nil {
 		return err
@@ -81,130 +373,216 @@ func (client *Client) requestAccessToken() error {
 	if err != nil {
 		return err
 	}
+	token.ObtainedAt = time.Now()
+
+	client.setToken(*token)
+
+	if client.TokenStore != nil {
+		if err := client.TokenStore.Save(ctx, *token); err != nil {
+			return err
+		}
+	}
 
-	client.setAccessToken(token.AccessToken)
 	return nil
 }
 
-func (client *Client) commonHTTPRequest(jsonBody interface{}, endpoint, verb string, retry bool) ([]byte, error) {
+// setToken applies token as the client's current access token, recording
+// when it's due to expire so ensureFreshToken can refresh it ahead of time.
+func (client *Client) setToken(token TokenResp) {
+	client.setAccessToken(token.AccessToken)
+
+	client.tokenMu.Lock()
+	client.tokenObtained = true
+	client.tokenExpiresAt = token.expiresAt()
+	client.tokenMu.Unlock()
+}
+
+func (client *Client) commonHTTPRequest(ctx context.Context, jsonBody interface{}, endpoint, verb string, retry bool) ([]byte, error) {
 	if jsonBody == nil {
 		jsonBody = struct{}{}
 	}
 
-	//
-
 	body, err := json.Marshal(jsonBody)
 
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(verb, client.buildURL(endpoint), bytes.NewReader(body))
-
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	httpClient := &http.Client{}
-	res, err := httpClient.Do(req)
-
-	if err != nil {
+	if err := client.ensureFreshToken(ctx); err != nil {
 		return nil, err
 	}
-	return client.retrieveResponse(res, req, jsonBody, endpoint, verb, retry)
-
-}
-
-func (client *Client) retrieveResponse(res *http.Response, req *http.Request, jsonBody interface{}, endpoint string, verb string, retry bool) ([]byte, error){
 
-	switch res.StatusCode {
-	case 200, 201:
-		if client.Throttled {
-			client.setThrottle(false)
-		}
-		defer res.Body.Close()
-		body, err := ioutil.ReadAll(res.Body)
-		return body, err
-	case 401:
-		if !retry {
-			err := client.requestAccessToken()
-			if err != nil {
+	var lastErr error
+	for attempt := 0; attempt <= client.maxRetries(); attempt++ {
+		if attempt > 0 {
+			if err := client.waitForRetry(ctx, lastErr, attempt); err != nil {
 				return nil, err
 			}
-			if req.Header.Get("Content-Type") == "application/json" {
-				return client.commonHTTPRequest(jsonBody, endpoint, "POST", true)
-			}else {
-				jsonBody := jsonBody.(TagRequest)
-				return client.fileHTTPRequest(jsonBody, endpoint, "", true)
-			}
 		}
-		return nil, errors.New("TOKEN_INVALID")
-	case 429:
-		client.setThrottle(true)
-		return nil, errors.New("THROTTLED")
-	case 400:
-		return nil, errors.New("ALL_ERROR")
-	case 500:
-		return nil, errors.New("CLARIFAI_ERROR")
-	default:
-		return nil, errors.New("UNEXPECTED_STATUS_CODE")
-	}
-}
-
-func (client *Client) fileHTTPRequest(jsonBody TagRequest,  endpoint string, verb string, retry bool) ([]byte, error) {
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+		req, err := http.NewRequestWithContext(ctx, verb, client.buildURL(endpoint), bytes.NewReader(body))
 
-	for idx, file := range jsonBody.Files {
-		// don't share file name information
-		fileWriter, err := writer.CreateFormFile("encoded_data", strconv.Itoa(idx))
 		if err != nil {
 			return nil, err
 		}
-		fp, err := os.Open(file)
+
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		req.Header.Set("Authorization", "Bearer "+client.token())
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := client.httpClient().Do(req)
 
 		if err != nil {
 			return nil, err
 		}
-		_, err = io.Copy(fileWriter, fp)
 
-		if err != nil {
-			return nil, err
+		data, err := client.retrieveResponse(ctx, res, req, jsonBody, endpoint, verb, retry)
+		if !isRetryableError(err) {
+			return data, err
 		}
+		lastErr = err
 	}
 
-	err := writer.WriteField("op", endpoint)
+	return nil, lastErr
+}
 
-	if err != nil {
-		return nil, err
+// waitForRetry sleeps for the backoff duration appropriate to err, honoring
+// ctx cancellation.
+func (client *Client) waitForRetry(ctx context.Context, err error, attempt int) error {
+	timer := time.NewTimer(client.backoffDuration(err, attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
+}
 
-	req, err := http.NewRequest("POST", client.buildURL(endpoint), body)
+// backoffDuration honors a Retry-After reported by the API, if any,
+// otherwise falls back to full-jitter exponential backoff.
+func (client *Client) backoffDuration(err error, attempt int) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
 
-	if err != nil {
-		return nil, err
+	backoff := client.baseBackoff() * time.Duration(int64(1)<<uint(attempt))
+	if max := client.maxBackoff(); backoff <= 0 || backoff > max {
+		backoff = max
 	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
 
+// isRetryableError reports whether err represents a throttled or transient
+// failure that's worth retrying with backoff.
+func isRetryableError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == ErrThrottled.Code || apiErr.Code == ErrClarifaiError.Code
+}
 
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+func (client *Client) retrieveResponse(ctx context.Context, res *http.Response, req *http.Request, jsonBody interface{}, endpoint string, verb string, retry bool) ([]byte, error) {
+	if client.ResponseInterceptor != nil {
+		if err := client.ResponseInterceptor(res); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
 
-	httpClient := &http.Client{}
-	res, err := httpClient.Do(req)
+	switch {
+	case res.StatusCode == 200, res.StatusCode == 201:
+		if client.IsThrottled() {
+			client.setThrottledUntil(time.Time{})
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		return body, err
+	case res.StatusCode == 401:
+		if !retry {
+			if err := client.refreshToken(ctx); err != nil {
+				return nil, err
+			}
+			if req.Header.Get("Content-Type") == "application/json" {
+				return client.commonHTTPRequest(ctx, jsonBody, endpoint, verb, true)
+			}
+			if body, ok := jsonBody.(TagRequest); ok {
+				if hasUnrepeatableReader(body.Inputs) {
+					// Reader-backed Inputs have already been consumed once
+					// and can't be streamed a second time, so an upload
+					// built from them can't be transparently retried after
+					// a token refresh.
+					return nil, fmt.Errorf("clarifai: cannot retry a reader-based upload after token refresh")
+				}
+				return client.fileHTTPRequest(ctx, body, endpoint, "", true)
+			}
+			// Readers passed to TagReaders have already been consumed once
+			// and can't be streamed a second time, so an upload built from
+			// them can't be transparently retried after a token refresh.
+			return nil, fmt.Errorf("clarifai: cannot retry a reader-based upload after token refresh")
+		}
+		return nil, client.apiError(res, endpoint, ErrTokenInvalid.Code, 0)
+	case res.StatusCode == 429:
+		retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), defaultThrottleCooldown)
+		client.setThrottledUntil(time.Now().Add(retryAfter))
+		return nil, client.apiError(res, endpoint, ErrThrottled.Code, retryAfter)
+	case res.StatusCode == 400:
+		return nil, client.apiError(res, endpoint, ErrAllError.Code, 0)
+	case res.StatusCode >= 500 && res.StatusCode < 600:
+		// The whole 5xx range is a transient failure on Clarifai's end
+		// (gateway/service-unavailable errors included, not just a literal
+		// 500) and is worth retrying with backoff.
+		retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), 0)
+		return nil, client.apiError(res, endpoint, ErrClarifaiError.Code, retryAfter)
+	default:
+		return nil, client.apiError(res, endpoint, ErrUnexpectedStatusCode.Code, 0)
+	}
+}
 
-	if err != nil {
-		return nil, err
+// apiError drains and closes res.Body, building an *APIError out of it. When
+// the body parses as Clarifai's structured error JSON, Message is replaced
+// with its status_msg.
+func (client *Client) apiError(res *http.Response, endpoint, code string, retryAfter time.Duration) *APIError {
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Code:       code,
+		Endpoint:   endpoint,
+		RetryAfter: retryAfter,
+		Message:    string(data),
 	}
 
-	return client.retrieveResponse(res, req, jsonBody, endpoint, verb, retry)
-}
+	var parsed clarifaiErrorBody
+	if json.Unmarshal(data, &parsed) == nil && parsed.StatusMsg != "" {
+		apiErr.Body = &parsed
+		apiErr.Message = parsed.StatusMsg
+	}
 
+	return apiErr
+}
 
+// parseRetryAfter parses a Retry-After header (either delta-seconds or an
+// HTTP-date), falling back to fallback when the header is absent or
+// unparseable.
+func parseRetryAfter(header string, fallback time.Duration) time.Duration {
+	if header == "" {
+		return fallback
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
 
 // Helper function to build URLs
 func (client *Client) buildURL(endpoint string) string {
@@ -214,13 +592,20 @@ func (client *Client) buildURL(endpoint string) string {
 
 // SetAccessToken will set accessToken to a new value
 func (client *Client) setAccessToken(token string) {
+	client.tokenMu.Lock()
 	client.AccessToken = token
+	client.tokenMu.Unlock()
 }
 
-func (client *Client) setAPIRoot(root string) {
-	client.APIRoot = root
+// token returns the client's current access token, synchronized against
+// concurrent setAccessToken calls (e.g. a 401 handler on another goroutine
+// rewriting it mid-request).
+func (client *Client) token() string {
+	client.tokenMu.Lock()
+	defer client.tokenMu.Unlock()
+	return client.AccessToken
 }
 
-func (client *Client) setThrottle(throttle bool) {
-	client.Throttled = throttle
+func (client *Client) setAPIRoot(root string) {
+	client.APIRoot = root
 }
@@ -0,0 +1,121 @@
+package clarifai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoffDurationHonorsRetryAfter(t *testing.T) {
+	client := NewClient("id", "secret")
+	apiErr := &APIError{Code: ErrThrottled.Code, RetryAfter: 5 * time.Second}
+
+	got := client.backoffDuration(apiErr, 0)
+	if got != 5*time.Second {
+		t.Fatalf("backoffDuration() = %v, want %v", got, 5*time.Second)
+	}
+}
+
+func TestBackoffDurationJitterIsBoundedAndGrows(t *testing.T) {
+	client := NewClient("id", "secret")
+	client.BaseBackoff = 100 * time.Millisecond
+	client.MaxBackoff = time.Second
+
+	for attempt := 0; attempt < 6; attempt++ {
+		want := client.baseBackoff() * time.Duration(int64(1)<<uint(attempt))
+		if want <= 0 || want > client.maxBackoff() {
+			want = client.maxBackoff()
+		}
+
+		for i := 0; i < 20; i++ {
+			got := client.backoffDuration(errors.New("transient"), attempt)
+			if got < 0 || got > want {
+				t.Fatalf("attempt %d: backoffDuration() = %v, want within [0, %v]", attempt, got, want)
+			}
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttled", &APIError{Code: ErrThrottled.Code}, true},
+		{"clarifai error", &APIError{Code: ErrClarifaiError.Code}, true},
+		{"token invalid", &APIError{Code: ErrTokenInvalid.Code}, false},
+		{"unexpected status", &APIError{Code: ErrUnexpectedStatusCode.Code}, false},
+		{"non-api error", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableError(tc.err); got != tc.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		fallback time.Duration
+		want     time.Duration
+	}{
+		{"absent", "", time.Second, time.Second},
+		{"delta seconds", "30", 0, 30 * time.Second},
+		{"unparseable", "not-a-date", time.Minute, time.Minute},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseRetryAfter(tc.header, tc.fallback); got != tc.want {
+				t.Errorf("parseRetryAfter(%q, %v) = %v, want %v", tc.header, tc.fallback, got, tc.want)
+			}
+		})
+	}
+
+	t.Run("http date", func(t *testing.T) {
+		when := time.Now().Add(time.Hour).UTC()
+		header := when.Format(http.TimeFormat)
+		got := parseRetryAfter(header, 0)
+		if got <= 0 || got > time.Hour {
+			t.Errorf("parseRetryAfter(%q, 0) = %v, want within (0, 1h]", header, got)
+		}
+	})
+}
+
+func Test5xxIsRetried(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status_code":200,"status_msg":"ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("id", "secret")
+	client.APIRoot = server.URL
+	client.tokenObtained = true
+	client.BaseBackoff = time.Millisecond
+	client.MaxBackoff = time.Millisecond
+
+	_, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v, want nil after retries", err)
+	}
+	if calls != 3 {
+		t.Fatalf("server got %d calls, want 3 (two 502s then a 200)", calls)
+	}
+}
@@ -0,0 +1,23 @@
+package clarifai
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// do performs a JSON request through commonHTTPRequest and decodes the
+// response into T, so each typed endpoint doesn't re-implement
+// json.Unmarshal.
+func do[T any](ctx context.Context, client *Client, jsonBody interface{}, endpoint, verb string) (T, error) {
+	var result T
+
+	body, err := client.commonHTTPRequest(ctx, jsonBody, endpoint, verb, false)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package clarifai
+
+import (
+	"fmt"
+	"time"
+)
+
+// clarifaiErrorBody is the structured error payload Clarifai returns in the
+// response body alongside a non-2xx status code.
+type clarifaiErrorBody struct {
+	StatusCode int    `json:"status_code"`
+	StatusMsg  string `json:"status_msg"`
+}
+
+// APIError is returned whenever the Clarifai API responds with a status
+// other than 200 or 201. Use errors.Is against the Err* sentinels below to branch on the
+// failure class, or errors.As to inspect the full detail.
+type APIError struct {
+	StatusCode int    // HTTP status code of the response
+	Code       string // coarse-grained class, e.g. "THROTTLED"
+	Message    string // human-readable message, from the body when available
+	Endpoint   string // endpoint that was called
+
+	// RetryAfter is populated on 429 and 5xx responses that carry a
+	// Retry-After header, and on every 429 without one (with the default
+	// throttle cool-down), and reflects how long the caller should wait
+	// before trying again.
+	RetryAfter time.Duration
+
+	// Body holds the raw "status_code"/"status_msg" fields Clarifai returns,
+	// when the response parses as JSON with a non-empty status_msg.
+	Body *clarifaiErrorBody
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("clarifai: %s: %s (http %d, endpoint %q)", e.Code, e.Message, e.StatusCode, e.Endpoint)
+}
+
+// Is lets errors.Is(err, ErrThrottled) and friends work: two *APIErrors
+// match if they carry the same coarse-grained Code.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+// Sentinel errors for the failure classes the Clarifai API can return.
+// Compare against these with errors.Is, e.g. errors.Is(err, ErrThrottled).
+var (
+	ErrTokenInvalid         = &APIError{Code: "TOKEN_INVALID"}
+	ErrThrottled            = &APIError{Code: "THROTTLED"}
+	ErrAllError             = &APIError{Code: "ALL_ERROR"}
+	ErrClarifaiError        = &APIError{Code: "CLARIFAI_ERROR"}
+	ErrUnexpectedStatusCode = &APIError{Code: "UNEXPECTED_STATUS_CODE"}
+)
@@ -0,0 +1,32 @@
+package clarifai
+
+import "context"
+
+// FeedbackItem corrects the tags on a single previously-tagged input.
+type FeedbackItem struct {
+	DocID      string   `json:"docid"`
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+}
+
+// FeedbackRequest batches add/remove tag corrections for multiple docids
+// into a single call.
+type FeedbackRequest struct {
+	Feedback []FeedbackItem `json:"feedback"`
+}
+
+// FeedbackResponse is the response from Feedback.
+type FeedbackResponse struct {
+	StatusCode int    `json:"status_code"`
+	StatusMsg  string `json:"status_msg"`
+}
+
+// Feedback submits tag corrections for one or more previously-tagged
+// inputs in a single call.
+func (client *Client) Feedback(ctx context.Context, req FeedbackRequest) (*FeedbackResponse, error) {
+	resp, err := do[FeedbackResponse](ctx, client, req, "feedback", "POST")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
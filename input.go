@@ -0,0 +1,125 @@
+package clarifai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Input is a single image to submit to the Clarifai API. Exactly one of
+// URL, FilePath, Reader or Base64 should be set; use the NewInputFrom*
+// constructors rather than building an Input by hand.
+type Input struct {
+	URL      string
+	FilePath string
+	Reader   io.Reader
+	Base64   string
+
+	// name is carried into the NamedReader of a Reader-backed input; the
+	// multipart part itself is always named by its index.
+	name string
+}
+
+// NewInputFromURL builds an Input for an image already hosted at url.
+func NewInputFromURL(url string) Input {
+	return Input{URL: url}
+}
+
+// NewInputFromFile builds an Input for a local image file.
+func NewInputFromFile(path string) Input {
+	return Input{FilePath: path}
+}
+
+// NewInputFromReader builds an Input for an in-memory image, read lazily
+// when the request is sent.
+func NewInputFromReader(name string, r io.Reader) Input {
+	return Input{Reader: r, name: name}
+}
+
+// NewInputFromBase64 builds an Input for a base64-encoded image.
+func NewInputFromBase64(data string) Input {
+	return Input{Base64: data}
+}
+
+// isMultipart reports whether in must be transported as a multipart form
+// part rather than inline JSON.
+func (in Input) isMultipart() bool {
+	return in.FilePath != "" || in.Reader != nil
+}
+
+// hasUnrepeatableReader reports whether any Input in inputs carries a
+// Reader - namedReader returns that same, already-drained io.Reader on a
+// second call, so a batch like this can't be transparently retried.
+func hasUnrepeatableReader(inputs []Input) bool {
+	for _, in := range inputs {
+		if in.Reader != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// namedReader opens (or reuses) the underlying reader for a multipart
+// Input, naming the NamedReader idx when in wasn't built with
+// NewInputFromReader.
+func (in Input) namedReader(idx int) (NamedReader, error) {
+	if in.Reader != nil {
+		name := in.name
+		if name == "" {
+			name = strconv.Itoa(idx)
+		}
+		return NamedReader{Name: name, Reader: in.Reader}, nil
+	}
+
+	fp, err := os.Open(in.FilePath)
+	if err != nil {
+		return NamedReader{}, err
+	}
+	return NamedReader{Name: strconv.Itoa(idx), Reader: fp}, nil
+}
+
+// MarshalJSON renders only the JSON-transportable fields of an Input.
+// FilePath and Reader based inputs are never marshaled this way - they're
+// routed through the multipart path instead, see inputTransport.
+func (in Input) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		URL    string `json:"url,omitempty"`
+		Base64 string `json:"base64,omitempty"`
+	}{URL: in.URL, Base64: in.Base64})
+}
+
+// inputTransport reports whether inputs as a whole must be sent as
+// multipart rather than inline JSON. Clarifai's tag endpoint doesn't
+// support mixing inline-JSON (URL/Base64) and multipart (FilePath/Reader)
+// inputs in the same request, so a non-empty batch of both is rejected
+// rather than silently dropping one kind.
+func inputTransport(inputs []Input) (multipart bool, err error) {
+	var sawJSON, sawMultipart bool
+	for _, in := range inputs {
+		if in.isMultipart() {
+			sawMultipart = true
+		} else {
+			sawJSON = true
+		}
+	}
+
+	if sawJSON && sawMultipart {
+		return false, fmt.Errorf("clarifai: mixed batches of URL/Base64 and FilePath/Reader inputs aren't supported; send them as separate requests")
+	}
+	return sawMultipart, nil
+}
+
+// requireJSONInputs returns an error if any Input in inputs needs multipart
+// transport, for endpoints that only ever send their body as JSON.
+func requireJSONInputs(inputs []Input) error {
+	multipart, err := inputTransport(inputs)
+	if err != nil {
+		return err
+	}
+	if multipart {
+		return fmt.Errorf("clarifai: this endpoint only accepts URL or Base64 inputs, not FilePath or Reader")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package clarifai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Concept is a single predicted or searched-for tag, with Clarifai's
+// confidence that it applies.
+type Concept struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// Model describes a Clarifai model.
+type Model struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PredictOutput is a single input's predictions from a model.
+type PredictOutput struct {
+	ID   string `json:"id"`
+	Data struct {
+		Concepts []Concept `json:"concepts"`
+	} `json:"data"`
+}
+
+// PredictResponse is the response from PredictWithModel.
+type PredictResponse struct {
+	StatusCode int             `json:"status_code"`
+	StatusMsg  string          `json:"status_msg"`
+	Outputs    []PredictOutput `json:"outputs"`
+}
+
+type predictRequest struct {
+	Inputs []Input `json:"inputs"`
+}
+
+// PredictWithModel runs inputs through the given model. modelVersion may be
+// empty to use the model's default version.
+func (client *Client) PredictWithModel(ctx context.Context, modelID, modelVersion string, inputs []Input) (*PredictResponse, error) {
+	// Prediction requests are always JSON - reject FilePath/Reader inputs
+	// up front instead of silently serializing them to {}.
+	if err := requireJSONInputs(inputs); err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("models/%s/outputs", modelID)
+	if modelVersion != "" {
+		endpoint = fmt.Sprintf("models/%s/versions/%s/outputs", modelID, modelVersion)
+	}
+
+	resp, err := do[PredictResponse](ctx, client, predictRequest{Inputs: inputs}, endpoint, "POST")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ModelListResponse is the response from ListModels.
+type ModelListResponse struct {
+	StatusCode int     `json:"status_code"`
+	StatusMsg  string  `json:"status_msg"`
+	Models     []Model `json:"models"`
+}
+
+// ListModels returns every model available to the client.
+func (client *Client) ListModels(ctx context.Context) (*ModelListResponse, error) {
+	resp, err := do[ModelListResponse](ctx, client, nil, "models", "GET")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateModelRequest describes a model to create.
+type CreateModelRequest struct {
+	Model Model `json:"model"`
+}
+
+// ModelResponse is the response from CreateModel and TrainModel.
+type ModelResponse struct {
+	StatusCode int    `json:"status_code"`
+	StatusMsg  string `json:"status_msg"`
+	Model      Model  `json:"model"`
+}
+
+// CreateModel registers a new model.
+func (client *Client) CreateModel(ctx context.Context, req CreateModelRequest) (*ModelResponse, error) {
+	resp, err := do[ModelResponse](ctx, client, req, "models", "POST")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TrainModel kicks off training a new version of modelID from its current
+// inputs.
+func (client *Client) TrainModel(ctx context.Context, modelID string) (*ModelResponse, error) {
+	endpoint := fmt.Sprintf("models/%s/versions", modelID)
+
+	resp, err := do[ModelResponse](ctx, client, nil, endpoint, "POST")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// InputRef identifies a single input returned from a search.
+type InputRef struct {
+	ID   string `json:"id"`
+	Data struct {
+		Image struct {
+			URL string `json:"url"`
+		} `json:"image"`
+	} `json:"data"`
+}
+
+// SearchHit is a single search result, along with its match score.
+type SearchHit struct {
+	Score float64  `json:"score"`
+	Input InputRef `json:"input"`
+}
+
+// SearchQuery is the Clarifai query clause used by SearchInputsRequest.
+type SearchQuery struct {
+	Ands []SearchClause `json:"ands"`
+}
+
+// SearchClause matches inputs whose predicted concepts include Concepts.
+type SearchClause struct {
+	Output struct {
+		Data struct {
+			Concepts []Concept `json:"concepts"`
+		} `json:"data"`
+	} `json:"output"`
+}
+
+// SearchInputsRequest is the request body for SearchInputs.
+type SearchInputsRequest struct {
+	Query SearchQuery `json:"query"`
+}
+
+// SearchInputsResponse is the response from SearchInputs.
+type SearchInputsResponse struct {
+	StatusCode int         `json:"status_code"`
+	StatusMsg  string      `json:"status_msg"`
+	Hits       []SearchHit `json:"hits"`
+}
+
+// SearchInputs finds previously uploaded inputs matching req.
+func (client *Client) SearchInputs(ctx context.Context, req SearchInputsRequest) (*SearchInputsResponse, error) {
+	resp, err := do[SearchInputsResponse](ctx, client, req, "searches", "POST")
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,29 @@
+package clarifai
+
+import "context"
+
+// TagRequest describes a batch of images to submit to the tag endpoint.
+// Inputs are transported as JSON (URL or Base64) or multipart (FilePath or
+// Reader), whichever the batch as a whole requires - see inputTransport.
+type TagRequest struct {
+	Inputs []Input `json:"inputs"`
+}
+
+// Tag submits a batch of images to endpoint.
+func (client *Client) Tag(ctx context.Context, endpoint string, req TagRequest) ([]byte, error) {
+	multipart, err := inputTransport(req.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	if multipart {
+		return client.fileHTTPRequest(ctx, req, endpoint, "", false)
+	}
+	return client.commonHTTPRequest(ctx, req, endpoint, "POST", false)
+}
+
+// TagReaders submits a batch of in-memory readers to endpoint, so callers
+// can tag images pulled from HTTP responses, S3, or memory without writing
+// them to disk first.
+func (client *Client) TagReaders(ctx context.Context, endpoint string, readers []NamedReader) ([]byte, error) {
+	return client.readerHTTPRequest(ctx, readers, endpoint)
+}
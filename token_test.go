@@ -0,0 +1,95 @@
+package clarifai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommonHTTPRequestRetriesOnceAfter401(t *testing.T) {
+	var calls int
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/token" {
+			_ = json.NewEncoder(w).Encode(TokenResp{AccessToken: "refreshed"})
+			return
+		}
+
+		calls++
+		methods = append(methods, r.Method)
+		if r.Header.Get("Authorization") != "Bearer refreshed" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status_code":200,"status_msg":"ok"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("id", "secret")
+	client.APIRoot = server.URL
+	client.tokenObtained = true
+
+	_, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v, want nil after a single 401 retry", err)
+	}
+	if calls != 2 {
+		t.Fatalf("server got %d calls to the API endpoint, want 2 (initial 401 then retried success)", calls)
+	}
+	for _, m := range methods {
+		if m != http.MethodGet {
+			t.Errorf("retried request used method %q, want %q preserved from the original verb", m, http.MethodGet)
+		}
+	}
+}
+
+func TestCommonHTTPRequestDoesNotRetryTwiceAfter401(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/token" {
+			_ = json.NewEncoder(w).Encode(TokenResp{AccessToken: "still-bad"})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient("id", "secret")
+	client.APIRoot = server.URL
+	client.tokenObtained = true
+
+	_, err := client.ListModels(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != ErrTokenInvalid.Code {
+		t.Fatalf("ListModels() error = %v, want an ErrTokenInvalid APIError after the retried request is also a 401", err)
+	}
+}
+
+func TestTagWithReaderInputErrorsInsteadOfRetryingAfter401(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/token" {
+			_ = json.NewEncoder(w).Encode(TokenResp{AccessToken: "refreshed"})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient("id", "secret")
+	client.APIRoot = server.URL
+	client.tokenObtained = true
+
+	req := TagRequest{Inputs: []Input{NewInputFromReader("image", strings.NewReader("hello-image-bytes"))}}
+
+	_, err := client.Tag(context.Background(), "models/x/outputs", req)
+	if err == nil {
+		t.Fatal("Tag() error = nil, want an error rather than silently re-sending a drained reader")
+	}
+	if strings.Contains(err.Error(), "http") {
+		t.Fatalf("Tag() error = %v, want the explicit cannot-retry error, not an HTTP-layer error", err)
+	}
+}
@@ -0,0 +1,42 @@
+package clarifai
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// FileTokenStore persists a TokenResp as JSON at Path, so a short-lived CLI
+// doesn't request a new token on every invocation and a long-running
+// service can share a cached token across restarts.
+type FileTokenStore struct {
+	Path string
+}
+
+// NewFileTokenStore returns a FileTokenStore backed by path.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+// Load reads the token previously written by Save.
+func (s *FileTokenStore) Load(ctx context.Context) (TokenResp, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return TokenResp{}, err
+	}
+
+	var token TokenResp
+	if err := json.Unmarshal(data, &token); err != nil {
+		return TokenResp{}, err
+	}
+	return token, nil
+}
+
+// Save writes token to Path, replacing whatever was there before.
+func (s *FileTokenStore) Save(ctx context.Context, token TokenResp) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
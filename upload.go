@@ -0,0 +1,179 @@
+package clarifai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// copyChunkSize is the buffer size used while streaming a file into a
+// multipart part, so size limits can be enforced without reading the whole
+// file into memory first.
+const copyChunkSize = 32 * 1024
+
+// NamedReader pairs an io.Reader with a name, letting callers tag images
+// pulled from HTTP responses, S3, or memory without writing them to disk
+// first.
+type NamedReader struct {
+	Name   string
+	Reader io.Reader
+}
+
+// uploadCounter tracks the total number of bytes written across every file
+// in a batch, so the batch can be rejected as soon as it exceeds
+// Client.MaxRequestSize instead of after it has been fully streamed.
+type uploadCounter struct {
+	mu    sync.Mutex
+	bytes int64
+	limit int64
+}
+
+func (c *uploadCounter) add(n int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytes += n
+	if c.limit > 0 && c.bytes > c.limit {
+		return fmt.Errorf("clarifai: upload exceeds the %d byte per-request limit", c.limit)
+	}
+	return nil
+}
+
+func (client *Client) fileHTTPRequest(ctx context.Context, jsonBody TagRequest, endpoint string, verb string, retry bool) ([]byte, error) {
+	readers := make([]NamedReader, len(jsonBody.Inputs))
+	for idx, in := range jsonBody.Inputs {
+		reader, err := in.namedReader(idx)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := reader.Reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		readers[idx] = reader
+	}
+
+	return client.streamMultipartRequest(ctx, readers, endpoint, verb, jsonBody, retry)
+}
+
+func (client *Client) readerHTTPRequest(ctx context.Context, readers []NamedReader, endpoint string) ([]byte, error) {
+	return client.streamMultipartRequest(ctx, readers, endpoint, "", readers, false)
+}
+
+// streamMultipartRequest writes every reader into its own multipart part
+// without buffering the whole batch in memory: the multipart body is piped
+// straight into the request as it's produced. Up to
+// Client.UploadConcurrency worker goroutines run at once, and the first
+// error cancels the rest; since a multipart.Writer finishes a part as soon
+// as the next one is created, each worker holds a mutex for the whole of its
+// part, so the parts are written to the shared writer one file at a time.
+func (client *Client) streamMultipartRequest(ctx context.Context, files []NamedReader, endpoint, verb string, retryBody interface{}, retry bool) ([]byte, error) {
+	if err := client.ensureFreshToken(ctx); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	group, gctx := errgroup.WithContext(ctx)
+	group.SetLimit(client.uploadConcurrency())
+
+	var writeMu sync.Mutex
+	counter := &uploadCounter{limit: client.maxRequestSize()}
+
+	for idx, file := range files {
+		idx, file := idx, file
+		group.Go(func() error {
+			return client.writeMultipartFile(gctx, writer, &writeMu, counter, idx, file)
+		})
+	}
+
+	go func() {
+		err := group.Wait()
+
+		writeMu.Lock()
+		if err == nil {
+			err = writer.WriteField("op", endpoint)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		writeMu.Unlock()
+
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", client.buildURL(endpoint), pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+client.token())
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := client.httpClient().Do(req)
+	if err != nil {
+		// If the request body was never fully read (a dial failure or
+		// context cancellation before it was sent), nothing is left to
+		// drain pr - close it so the writeMultipartFile goroutines blocked
+		// writing into the pipe unblock instead of leaking.
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	defer pr.Close()
+
+	return client.retrieveResponse(ctx, res, req, retryBody, endpoint, verb, retry)
+}
+
+// writeMultipartFile streams a single file into its own form part, rejecting
+// it as soon as it exceeds Client.MaxFileSize or pushes the batch past
+// Client.MaxRequestSize. file.Reader is read in copyChunkSize pieces so the
+// whole file is never buffered in memory. mu is held from CreateFormFile
+// until the file has been fully written, because the shared
+// multipart.Writer finishes a part as soon as the next one is created; a
+// slow reader therefore holds up the other uploads of the batch.
+func (client *Client) writeMultipartFile(ctx context.Context, writer *multipart.Writer, mu *sync.Mutex, counter *uploadCounter, idx int, file NamedReader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// don't share file name information
+	fileWriter, err := writer.CreateFormFile("encoded_data", strconv.Itoa(idx))
+	if err != nil {
+		return err
+	}
+
+	maxFileSize := client.maxFileSize()
+	buf := make([]byte, copyChunkSize)
+	var written int64
+
+	for {
+		n, rerr := file.Reader.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			if maxFileSize > 0 && written > maxFileSize {
+				return fmt.Errorf("clarifai: file %d exceeds the %d byte per-file limit", idx, maxFileSize)
+			}
+			if err := counter.add(int64(n)); err != nil {
+				return err
+			}
+			_, werr := fileWriter.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
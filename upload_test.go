@@ -0,0 +1,126 @@
+package clarifai
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadCounterRejectsOverLimit(t *testing.T) {
+	counter := &uploadCounter{limit: 10}
+
+	if err := counter.add(6); err != nil {
+		t.Fatalf("add(6) error = %v, want nil", err)
+	}
+	if err := counter.add(4); err != nil {
+		t.Fatalf("add(4) error = %v, want nil (exactly at limit)", err)
+	}
+	if err := counter.add(1); err == nil {
+		t.Fatal("add(1) error = nil, want an error once the batch exceeds the limit")
+	}
+}
+
+func TestWriteMultipartFileRejectsOversizedFile(t *testing.T) {
+	client := NewClient("id", "secret")
+	client.MaxFileSize = 8
+
+	var buf strings.Builder
+	writer := multipart.NewWriter(&buf)
+	var mu sync.Mutex
+	counter := &uploadCounter{limit: 0}
+
+	file := NamedReader{Name: "big", Reader: strings.NewReader("this is way more than 8 bytes")}
+	err := client.writeMultipartFile(context.Background(), writer, &mu, counter, 0, file)
+	if err == nil {
+		t.Fatal("writeMultipartFile() error = nil, want an error for a file over MaxFileSize")
+	}
+}
+
+func TestWriteMultipartFileAcceptsFileUnderLimit(t *testing.T) {
+	client := NewClient("id", "secret")
+	client.MaxFileSize = 1024
+
+	var buf strings.Builder
+	writer := multipart.NewWriter(&buf)
+	var mu sync.Mutex
+	counter := &uploadCounter{limit: 0}
+
+	file := NamedReader{Name: "small", Reader: strings.NewReader("hello")}
+	if err := client.writeMultipartFile(context.Background(), writer, &mu, counter, 0, file); err != nil {
+		t.Fatalf("writeMultipartFile() error = %v, want nil", err)
+	}
+	_ = writer.Close()
+
+	if !strings.Contains(buf.String(), "hello") {
+		t.Fatal("multipart body doesn't contain the written file content")
+	}
+}
+
+func TestWriteMultipartFileRejectsOverRequestLimit(t *testing.T) {
+	client := NewClient("id", "secret")
+
+	var buf strings.Builder
+	writer := multipart.NewWriter(&buf)
+	var mu sync.Mutex
+	counter := &uploadCounter{limit: 4}
+
+	file := NamedReader{Name: "f", Reader: strings.NewReader("more than four bytes")}
+	err := client.writeMultipartFile(context.Background(), writer, &mu, counter, 0, file)
+	if err == nil {
+		t.Fatal("writeMultipartFile() error = nil, want an error once the request-wide limit is exceeded")
+	}
+}
+
+func TestWriteMultipartFileStreamsAcrossChunkBoundary(t *testing.T) {
+	client := NewClient("id", "secret")
+
+	var buf strings.Builder
+	writer := multipart.NewWriter(&buf)
+	var mu sync.Mutex
+	counter := &uploadCounter{limit: 0}
+
+	content := strings.Repeat("a", copyChunkSize) + strings.Repeat("b", copyChunkSize) + "tail"
+	file := NamedReader{Name: "big", Reader: strings.NewReader(content)}
+	if err := client.writeMultipartFile(context.Background(), writer, &mu, counter, 0, file); err != nil {
+		t.Fatalf("writeMultipartFile() error = %v, want nil", err)
+	}
+	_ = writer.Close()
+
+	if !strings.Contains(buf.String(), content) {
+		t.Fatal("multipart body doesn't contain the full file content written across multiple chunks")
+	}
+}
+
+type erroringRoundTripper struct{}
+
+func (erroringRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("dial failed")
+}
+
+func TestStreamMultipartRequestUnblocksWritersOnDoFailure(t *testing.T) {
+	client := NewClient("id", "secret")
+	client.tokenObtained = true
+	client.HTTPClient = &http.Client{Transport: erroringRoundTripper{}}
+
+	readers := []NamedReader{{Name: "a", Reader: strings.NewReader(strings.Repeat("x", copyChunkSize*2))}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.TagReaders(context.Background(), "endpoint", readers)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("TagReaders() error = nil, want the RoundTrip failure surfaced")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("TagReaders() did not return - writer goroutines appear to be leaked/blocked on the unclosed pipe")
+	}
+}